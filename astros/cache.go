@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// cachePath returns where the last successful live response is stored, in the
+// user's cache directory.
+func cachePath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "structs", "astros.cache.json"), nil
+}
+
+// cachedAstros is a live response along with the time it was fetched.
+type cachedAstros struct {
+	Fetched time.Time `json:"fetched"`
+	Astros  astros    `json:"astros"`
+}
+
+// readCache reads a cached live response from path.
+func readCache(path string) (cachedAstros, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return cachedAstros{}, err
+	}
+	var c cachedAstros
+	if err := json.Unmarshal(b, &c); err != nil {
+		return cachedAstros{}, err
+	}
+	return c, nil
+}
+
+// writeCache stores a as the latest live response in path.
+func writeCache(path string, a astros) error {
+	b, err := json.Marshal(cachedAstros{Fetched: time.Now(), Astros: a})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0644)
+}
+
+// fetchCached returns the cached live response from path if it is younger than
+// ttl. Otherwise it fetches the astronauts from url and updates the cache. If
+// the fetch fails, a stale cached response is used instead.
+func fetchCached(ctx context.Context, url, path string, ttl time.Duration) (astros, error) {
+	c, cacheErr := readCache(path)
+	if cacheErr != nil && !errors.Is(cacheErr, os.ErrNotExist) {
+		slog.Warn("ignoring the cache", "file", path, "err", cacheErr)
+	}
+	if cacheErr == nil && time.Since(c.Fetched) < ttl {
+		return c.Astros, nil
+	}
+
+	a, err := fetchAstros(ctx, url)
+	if err != nil {
+		if cacheErr != nil {
+			return astros{}, err
+		}
+		slog.Warn("unable to fetch live data, using the cache", "file", path, "fetched", c.Fetched, "err", err)
+		return c.Astros, nil
+	}
+	if err := writeCache(path, a); err != nil {
+		slog.Warn("unable to write the cache", "file", path, "err", err)
+	}
+	return a, nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFetchCached(t *testing.T) {
+	cached := astros{People: []astro{{"Tiangong", "Ye Guangfu"}}, Number: 1}
+	for _, tc := range []struct {
+		desc     string
+		age      time.Duration
+		response apiResponse
+		wantHits int
+		want     string
+	}{
+		{"fresh cache", time.Minute, crewResponse, 0, "Ye Guangfu"},
+		{"expired cache", time.Hour, crewResponse, 1, "Mark Vande Hei"},
+		{"stale cache on 404", time.Hour, apiResponse{status: http.StatusNotFound}, 1, "Ye Guangfu"},
+		{"stale cache on 5xx", time.Hour, apiResponse{status: http.StatusServiceUnavailable}, fetchAttempts, "Ye Guangfu"},
+	} {
+		path := filepath.Join(t.TempDir(), "astros.cache.json")
+		b, err := json.Marshal(cachedAstros{Fetched: time.Now().Add(-tc.age), Astros: cached})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, b, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		url, hits := newAPIServer(t, tc.response)
+		a, err := fetchCached(context.Background(), url, path, 10*time.Minute)
+
+		if err != nil {
+			t.Errorf("%s: got error %v", tc.desc, err)
+			continue
+		}
+		if *hits != tc.wantHits {
+			t.Errorf("%s: got %d requests, want %d", tc.desc, *hits, tc.wantHits)
+		}
+		if len(a.People) != 1 || a.People[0].Name != tc.want {
+			t.Errorf("%s: got %+v, want %s", tc.desc, a, tc.want)
+		}
+		c, err := readCache(path)
+		if err != nil {
+			t.Errorf("%s: got error %v reading the cache", tc.desc, err)
+		} else if len(c.Astros.People) != 1 || c.Astros.People[0].Name != tc.want {
+			t.Errorf("%s: got cached %+v, want %s", tc.desc, c.Astros, tc.want)
+		}
+	}
+}
+
+func TestWriteCacheCreatesDir(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "structs", "astros.cache.json")
+	if err := writeCache(path, astros{People: []astro{{"ISS", "Raja Chari"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readCache(path); err != nil {
+		t.Errorf("got error %v", err)
+	}
+}
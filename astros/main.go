@@ -2,33 +2,520 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
+	"math/rand"
+	"mime"
+	"net/http"
 	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"structs/internal/load"
+	"structs/internal/record"
+
+	"gopkg.in/yaml.v3"
 )
 
+// apiURL is the live list of astronauts who are currently in space.
+const apiURL = "http://api.open-notify.org/astros.json"
+
+// maxBodySize is the largest live response that is read.
+const maxBodySize = 1 << 20
+
+// errEmptyBody is returned when the API responds with an empty body.
+var errEmptyBody = errors.New("empty response body")
+
+// fetchAttempts is the number of times a live request is attempted.
+const fetchAttempts = 3
+
+// fetchBackoff is the delay before the first retry. It doubles after each
+// failed attempt.
+var fetchBackoff = 500 * time.Millisecond
+
 type (
 	astro struct {
-		Craft, Name string
+		Craft string `json:"craft" xml:"craft" yaml:"craft"`
+		Name  string `json:"name" xml:"name" yaml:"name"`
 	}
 	astros struct {
-		People []astro
+		People  []astro `json:"people" xml:"people>astro" yaml:"people"`
+		Number  int     `json:"number" xml:"number" yaml:"number"`
+		Message string  `json:"message" xml:"message" yaml:"message,omitempty"`
 	}
 )
 
+// astroHeaders names the columns returned by astro.Fields.
+var astroHeaders = []string{"Craft", "Name"}
+
+// Fields implements record.Record.
+func (p astro) Fields() []string {
+	return []string{p.Craft, p.Name}
+}
+
+// records adapts a to a slice of records.
+func (a astros) records() []record.Record {
+	recs := make([]record.Record, len(a.People))
+	for i, p := range a.People {
+		recs[i] = p
+	}
+	return recs
+}
+
+// MarshalJSON encodes a in the open-notify format. The number field is always
+// recomputed from the list of people.
+func (a astros) MarshalJSON() ([]byte, error) {
+	type plain astros
+	a.Number = len(a.People)
+	return json.Marshal(plain(a))
+}
+
+// MarshalYAML encodes a with the same keys as MarshalJSON. The number field is
+// always recomputed from the list of people.
+func (a astros) MarshalYAML() (interface{}, error) {
+	type plain astros
+	a.Number = len(a.People)
+	return plain(a), nil
+}
+
+// writeYAML writes a to w as YAML.
+func writeYAML(w io.Writer, a astros) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(a); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// writeAstrosCSV writes the astronauts in a to w as CSV with a header row.
+// Rows are sorted by craft and then by name.
+func writeAstrosCSV(w io.Writer, a astros) error {
+	sorted := a
+	sorted.People = append([]astro(nil), a.People...)
+	sort.Slice(sorted.People, func(i, j int) bool {
+		pi, pj := sorted.People[i], sorted.People[j]
+		if pi.Craft != pj.Craft {
+			return pi.Craft < pj.Craft
+		}
+		return pi.Name < pj.Name
+	})
+	return record.WriteCSV(w, astroHeaders, sorted.records())
+}
+
+// byCraft returns the number of people on each craft.
+func (a astros) byCraft() map[string]int {
+	counts := make(map[string]int)
+	for _, p := range a.People {
+		counts[p.Craft]++
+	}
+	return counts
+}
+
+// onCraft returns the people on the given craft. The craft name is matched
+// case-insensitively, ignoring surrounding whitespace.
+func (a astros) onCraft(craft string) []astro {
+	craft = strings.TrimSpace(craft)
+	var crew []astro
+	for _, p := range a.People {
+		if strings.EqualFold(strings.TrimSpace(p.Craft), craft) {
+			crew = append(crew, p)
+		}
+	}
+	return crew
+}
+
+// random returns a crew member chosen deterministically by seed. It returns
+// false if no one is in space.
+func (a astros) random(seed int64) (astro, bool) {
+	if len(a.People) == 0 {
+		return astro{}, false
+	}
+	return a.People[rand.New(rand.NewSource(seed)).Intn(len(a.People))], true
+}
+
+// printGrouped writes the astronauts grouped by craft, followed by a total.
+// Crafts are sorted by crew size, largest first, and then alphabetically. The
+// names within each craft are sorted alphabetically.
+func (a astros) printGrouped(w io.Writer) {
+	if len(a.People) == 0 {
+		fmt.Fprintln(w, "(no one in space)")
+		return
+	}
+	crew := make(map[string][]string)
+	for _, p := range a.People {
+		crew[p.Craft] = append(crew[p.Craft], p.Name)
+	}
+	counts := a.byCraft()
+	crafts := make([]string, 0, len(counts))
+	for c := range counts {
+		crafts = append(crafts, c)
+	}
+	sort.Slice(crafts, func(i, j int) bool {
+		if ni, nj := counts[crafts[i]], counts[crafts[j]]; ni != nj {
+			return ni > nj
+		}
+		return crafts[i] < crafts[j]
+	})
+	for _, c := range crafts {
+		names := crew[c]
+		fmt.Fprintf(w, "%s (%d)\n", c, len(names))
+		sort.Strings(names)
+		for _, n := range names {
+			fmt.Fprintf(w, "    %s\n", n)
+		}
+	}
+	fmt.Fprintf(w, "Total: %d people across %d craft\n", len(a.People), len(crafts))
+}
+
+// trimSpace removes leading and trailing whitespace from the craft and name
+// of every person.
+func (a *astros) trimSpace() {
+	for i := range a.People {
+		a.People[i].Craft = strings.TrimSpace(a.People[i].Craft)
+		a.People[i].Name = strings.TrimSpace(a.People[i].Name)
+	}
+}
+
+// decodeAstros reads the list of astronauts as JSON from r.
+func decodeAstros(r io.Reader) (astros, error) {
+	var a astros
+	if err := json.NewDecoder(r).Decode(&a); err != nil {
+		return astros{}, err
+	}
+	a.trimSpace()
+	return a, nil
+}
+
+// decodeAstrosXML reads the list of astronauts as XML from r.
+func decodeAstrosXML(r io.Reader) (astros, error) {
+	var a astros
+	if err := xml.NewDecoder(r).Decode(&a); err != nil {
+		return astros{}, err
+	}
+	a.trimSpace()
+	return a, nil
+}
+
+// fetchAstros retrieves the current list of astronauts from the open-notify API
+// at url. Network errors and 5xx responses are retried with exponential backoff
+// until the attempts run out or ctx is cancelled.
+func fetchAstros(ctx context.Context, url string) (astros, error) {
+	backoff := fetchBackoff
+	for attempt := 1; ; attempt++ {
+		a, retry, err := getAstros(ctx, url)
+		if err == nil || !retry || attempt == fetchAttempts {
+			return a, err
+		}
+		slog.Warn("fetch failed, retrying", "attempt", attempt, "attempts", fetchAttempts, "backoff", backoff, "err", err)
+		select {
+		case <-ctx.Done():
+			return astros{}, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// getAstros makes a single request to the open-notify API at url. It reports
+// whether a failed request is worth retrying. The content type is checked
+// before the body, so an empty non-JSON response is reported as non-JSON.
+func getAstros(ctx context.Context, url string) (a astros, retry bool, err error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return astros{}, false, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return astros{}, true, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+	if err != nil {
+		return astros{}, true, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return astros{}, resp.StatusCode >= 500, fmt.Errorf("unexpected status %s: %q", resp.Status, snippet(body))
+	}
+	if ct, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); ct != "application/json" {
+		return astros{}, false, fmt.Errorf("unexpected content type %q: %q", ct, snippet(body))
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return astros{}, false, errEmptyBody
+	}
+	a, err = decodeAstros(bytes.NewReader(body))
+	if err != nil {
+		return astros{}, false, fmt.Errorf("malformed JSON %q: %w", snippet(body), err)
+	}
+	return a, false, nil
+}
+
+// snippet returns the start of a response body for error messages.
+func snippet(body []byte) string {
+	const n = 200
+	if len(body) > n {
+		return string(body[:n])
+	}
+	return string(body)
+}
+
+// loadAstros reads the list of astronauts from a file, or the standard input
+// if path is "-". The format is either "json" or "xml".
+func loadAstros(path, format string) (astros, error) {
+	var decode func(io.Reader) (astros, error)
+	switch format {
+	case "json":
+		decode = decodeAstros
+	case "xml":
+		decode = decodeAstrosXML
+	default:
+		return astros{}, fmt.Errorf("unknown format %q", format)
+	}
+	f, err := load.OpenReader(path)
+	if err != nil {
+		return astros{}, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	switch got := sniff(r); got {
+	case "":
+		return astros{}, fmt.Errorf("%s is empty", path)
+	case format, "unknown":
+	default:
+		return astros{}, fmt.Errorf("%s looks like %s, not %s; use -format %s", path, got, format, got)
+	}
+	a, err := decode(r)
+	if err != nil {
+		return astros{}, fmt.Errorf("unable to decode %s: %w", path, err)
+	}
+	return a, nil
+}
+
+// sniff guesses the format of r from its first non-whitespace byte without
+// consuming it. It returns "json", "xml", "unknown", or "" if r holds only
+// whitespace.
+func sniff(r *bufio.Reader) string {
+	b, _ := r.Peek(512)
+	b = bytes.TrimLeft(b, " \t\r\n")
+	if len(b) == 0 {
+		return ""
+	}
+	switch b[0] {
+	case '{', '[':
+		return "json"
+	case '<':
+		return "xml"
+	}
+	return "unknown"
+}
+
+// defaultFile returns the bundled local file for the given format.
+func defaultFile(format string) string {
+	return "astros/astros." + format
+}
+
+// sample is written to a missing local file when bootstrapping.
+var sample = astros{
+	People: []astro{
+		{Craft: "ISS", Name: "Mark Vande Hei"},
+		{Craft: "ISS", Name: "Pyotr Dubrov"},
+		{Craft: "Shenzhou 13", Name: "Zhai Zhigang"},
+	},
+	Number:  3,
+	Message: "success",
+}
+
+// bootstrap writes the sample astronauts to path in the given format if the
+// file does not exist yet.
+func bootstrap(path, format string) error {
+	_, err := os.Stat(path)
+	if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	var b []byte
+	switch format {
+	case "json":
+		b, err = json.MarshalIndent(sample, "", "  ")
+	case "xml":
+		b, err = xml.MarshalIndent(sample, "", "  ")
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
+	if err != nil {
+		return err
+	}
+	slog.Info("writing a sample file", "file", path)
+	return os.WriteFile(path, append(b, '\n'), 0644)
+}
+
+// readAstros returns the live list of astronauts if live is set and either
+// the API is reachable or a response younger than ttl is cached. Otherwise it
+// reads the file at path in the given format.
+func readAstros(live bool, ttl time.Duration, path, format string) (astros, error) {
+	if live {
+		var a astros
+		cache, err := cachePath()
+		if err == nil {
+			a, err = fetchCached(context.Background(), apiURL, cache, ttl)
+		} else {
+			slog.Warn("no cache directory, fetching without a cache", "err", err)
+			a, err = fetchAstros(context.Background(), apiURL)
+		}
+		if err == nil {
+			return a, nil
+		}
+		slog.Warn("unable to fetch live data, using the local file", "file", path, "err", err)
+	}
+	return loadAstros(path, format)
+}
+
+// isFlagSet reports whether the named flag was passed on the command line.
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// countTrue returns how many of bs are true.
+func countTrue(bs ...bool) int {
+	n := 0
+	for _, b := range bs {
+		if b {
+			n++
+		}
+	}
+	return n
+}
+
+// fatal logs an error and exits.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// newLogger returns a logger writing to the standard error in the given
+// format, either "text" or "json".
+func newLogger(format string) (*slog.Logger, error) {
+	switch format {
+	case "text":
+		return slog.New(slog.NewTextHandler(os.Stderr, nil)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(os.Stderr, nil)), nil
+	}
+	return nil, fmt.Errorf("unknown log format %q", format)
+}
+
 func main() {
+	live := flag.Bool("live", false, "fetch the astronauts from "+apiURL)
+	ttl := flag.Duration("ttl", 10*time.Minute, "reuse a cached live response younger than this")
 	// A list of astronauts who are currently on the ISS.
 	// Retrieved from http://api.open-notify.org/astros.json.
-	f, err := os.Open("astros/astros.json")
+	file := flag.String("file", "", `local file to read, or "-" for the standard input (default astros/astros.<format>)`)
+	format := flag.String("format", "json", "format of the local file: json or xml")
+	craft := flag.String("craft", "", "print only the crew of the named spacecraft")
+	output := flag.String("output", "grouped", "output format: grouped, table, csv or yaml")
+	count := flag.Bool("count", false, "print only the number of astronauts")
+	pick := flag.Bool("random", false, "print a single random astronaut")
+	seed := flag.Int64("seed", 0, "seed for -random (default a time-based seed)")
+	boot := flag.Bool("bootstrap", false, "write a sample local file if it does not exist")
+	addr := flag.String("serve", "", "serve the astronauts as JSON on this address, e.g. :8080")
+	logFormat := flag.String("log", "text", "log format: text or json")
+	flag.Parse()
+
+	logger, err := newLogger(*logFormat)
 	if err != nil {
-		log.Fatalf("unable to open a file: %v", err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	slog.SetDefault(logger)
+	if *format != "json" && *format != "xml" {
+		fmt.Fprintf(os.Stderr, "unknown format %q\n", *format)
+		os.Exit(2)
+	}
+	switch *output {
+	case "grouped", "table", "csv", "yaml":
+	default:
+		fmt.Fprintf(os.Stderr, "unknown output %q\n", *output)
+		os.Exit(2)
+	}
+	if countTrue(*count, *pick, isFlagSet("output")) > 1 {
+		fmt.Fprintln(os.Stderr, "-count, -random and -output cannot be combined")
+		os.Exit(2)
+	}
+	if *file == "" {
+		*file = defaultFile(*format)
+	}
+
+	if *boot && *file != load.Stdin {
+		if err := bootstrap(*file, *format); err != nil {
+			fatal("unable to bootstrap", "file", *file, "err", err)
+		}
+	}
+
+	if *addr != "" {
+		if err := serve(*addr, func() (astros, error) { return readAstros(*live, *ttl, *file, *format) }); err != nil {
+			fatal("server failed", "err", err)
+		}
+		return
 	}
-	defer f.Close()
 
-	astronauts := astros{}
-	if err := json.NewDecoder(bufio.NewReader(f)).Decode(&astronauts); err != nil {
-		log.Fatal(err)
+	astronauts, err := readAstros(*live, *ttl, *file, *format)
+	if err != nil {
+		fatal("unable to read astronauts", "file", *file, "err", err)
+	}
+	if astronauts.Number != len(astronauts.People) {
+		slog.Warn("number does not match the people listed", "number", astronauts.Number, "people", len(astronauts.People))
+	}
+	if *craft != "" {
+		crew := astronauts.onCraft(*craft)
+		if len(crew) == 0 && !*count && !*pick && *output == "grouped" {
+			fmt.Printf("no astronauts on %s\n", *craft)
+			return
+		}
+		astronauts.People, astronauts.Number = crew, len(crew)
+	}
+	if *count {
+		fmt.Println(len(astronauts.People))
+		return
+	}
+	if *pick {
+		if !isFlagSet("seed") {
+			*seed = time.Now().UnixNano()
+		}
+		p, ok := astronauts.random(*seed)
+		if !ok {
+			fmt.Println("(no one in space)")
+			return
+		}
+		fmt.Printf("%s (%s)\n", p.Name, p.Craft)
+		return
+	}
+	switch *output {
+	case "csv":
+		err = writeAstrosCSV(os.Stdout, astronauts)
+	case "yaml":
+		err = writeYAML(os.Stdout, astronauts)
+	case "table":
+		err = record.WriteTable(os.Stdout, astroHeaders, astronauts.records())
+	default:
+		astronauts.printGrouped(os.Stdout)
+	}
+	if err != nil {
+		fatal("unable to write output", "output", *output, "err", err)
 	}
-	fmt.Printf("%+v\n", astronauts)
 }
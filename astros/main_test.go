@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const crewJSON = `{"people":[{"craft":"ISS","name":"Mark Vande Hei"}],"number":1,"message":"success"}`
+
+func TestMain(m *testing.M) {
+	// Retries happen immediately in tests.
+	fetchBackoff = 0
+	os.Exit(m.Run())
+}
+
+// apiResponse is a canned reply of a fake open-notify API.
+type apiResponse struct {
+	status            int
+	contentType, body string
+}
+
+// crewResponse is a successful reply listing one astronaut.
+var crewResponse = apiResponse{http.StatusOK, "application/json", crewJSON}
+
+// newAPIServer starts a fake open-notify API that sends responses in order,
+// repeating the last one. It returns the server URL and a count of the requests
+// it received.
+func newAPIServer(t *testing.T, responses ...apiResponse) (string, *int) {
+	hits := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp := responses[len(responses)-1]
+		if hits < len(responses) {
+			resp = responses[hits]
+		}
+		hits++
+		if resp.contentType != "" {
+			w.Header().Set("Content-Type", resp.contentType)
+		}
+		w.WriteHeader(resp.status)
+		w.Write([]byte(resp.body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL, &hits
+}
+
+func TestFetchAstros(t *testing.T) {
+	for _, tc := range []struct {
+		desc      string
+		responses []apiResponse
+		cancel    bool
+		wantHits  int
+		wantErr   bool
+	}{
+		{"ok", []apiResponse{crewResponse}, false, 1, false},
+		{"5xx is retried", []apiResponse{{status: 503}, crewResponse}, false, 2, false},
+		{"5xx until attempts run out", []apiResponse{{status: 503}}, false, fetchAttempts, true},
+		{"404 is not retried", []apiResponse{{status: 404}}, false, 1, true},
+		{"cancelled context", []apiResponse{crewResponse}, true, 0, true},
+	} {
+		url, hits := newAPIServer(t, tc.responses...)
+		ctx, cancel := context.WithCancel(context.Background())
+		if tc.cancel {
+			cancel()
+		}
+		a, err := fetchAstros(ctx, url)
+		cancel()
+
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%s: got error %v, want error %v", tc.desc, err, tc.wantErr)
+		}
+		if tc.cancel && !errors.Is(err, context.Canceled) {
+			t.Errorf("%s: got error %v, want %v", tc.desc, err, context.Canceled)
+		}
+		if *hits != tc.wantHits {
+			t.Errorf("%s: got %d requests, want %d", tc.desc, *hits, tc.wantHits)
+		}
+		if !tc.wantErr && len(a.People) != 1 {
+			t.Errorf("%s: got %+v, want one person", tc.desc, a)
+		}
+	}
+}
+
+func TestMarshalJSONRoundTrip(t *testing.T) {
+	want, err := loadAstros("astros.json", "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want.Message = "success"
+	b, err := json.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := decodeAstros(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v want %+v", got, want)
+	}
+}
+
+func TestMarshalJSONRecomputesNumber(t *testing.T) {
+	b, err := json.Marshal(astros{People: []astro{{"ISS", "Raja Chari"}, {"ISS", "Tom Marshburn"}}, Number: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := decodeAstros(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Number != 2 {
+		t.Errorf("got number %d want 2", got.Number)
+	}
+}
+
+func TestLoadAstrosFormat(t *testing.T) {
+	for _, tc := range []struct {
+		path, format string
+		wantErr      string
+	}{
+		{"astros.json", "json", ""},
+		{"astros.xml", "xml", ""},
+		{"astros.json", "xml", "astros.json looks like json, not xml; use -format json"},
+		{"astros.xml", "json", "astros.xml looks like xml, not json; use -format xml"},
+	} {
+		a, err := loadAstros(tc.path, tc.format)
+		if tc.wantErr != "" {
+			if err == nil || err.Error() != tc.wantErr {
+				t.Errorf("loadAstros(%q, %q): got error %v want %q", tc.path, tc.format, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil || len(a.People) != 10 {
+			t.Errorf("loadAstros(%q, %q): got %d people, error %v; want 10 people", tc.path, tc.format, len(a.People), err)
+		}
+	}
+}
+
+func TestGetAstrosBadResponse(t *testing.T) {
+	for _, tc := range []struct {
+		desc, contentType, body string
+		want                    func(error) bool
+	}{
+		{"html page", "text/html", "<html>Service Unavailable</html>", func(err error) bool {
+			return strings.Contains(err.Error(), `"text/html"`) && strings.Contains(err.Error(), "Service Unavailable")
+		}},
+		{"empty html page", "text/html", "", func(err error) bool {
+			return strings.Contains(err.Error(), `"text/html"`)
+		}},
+		{"empty body", "application/json", "", func(err error) bool {
+			return errors.Is(err, errEmptyBody)
+		}},
+		{"truncated json", "application/json; charset=utf-8", `{"people":[`, func(err error) bool {
+			return errors.Is(err, io.ErrUnexpectedEOF) && strings.Contains(err.Error(), `{\"people\":[`)
+		}},
+	} {
+		url, _ := newAPIServer(t, apiResponse{http.StatusOK, tc.contentType, tc.body})
+		_, retry, err := getAstros(context.Background(), url)
+
+		if err == nil || !tc.want(err) {
+			t.Errorf("%s: got unexpected error %v", tc.desc, err)
+		}
+		if retry {
+			t.Errorf("%s: got retry, want none", tc.desc)
+		}
+	}
+}
+
+func TestRandom(t *testing.T) {
+	a, err := loadAstros("astros.json", "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, seed := range []int64{0, 1, 42} {
+		first, ok := a.random(seed)
+		if !ok {
+			t.Errorf("random(%d): got no one", seed)
+		}
+		if again, _ := a.random(seed); again != first {
+			t.Errorf("random(%d): got %+v then %+v", seed, first, again)
+		}
+	}
+	if got, ok := (astros{}).random(42); got != (astro{}) || ok {
+		t.Errorf("random on empty crew: got (%+v, %t) want (astro{}, false)", got, ok)
+	}
+}
+
+func TestDecodeTrimsSpace(t *testing.T) {
+	want := []astro{{"ISS", "Mark Vande Hei"}, {"Shenzhou 13", "Ye Guangfu"}}
+	for _, tc := range []struct {
+		desc   string
+		decode func(io.Reader) (astros, error)
+		input  string
+	}{
+		{"json", decodeAstros, `{"people":[{"craft":" ISS ","name":" Mark Vande Hei "},{"craft":"Shenzhou 13\t","name":"\nYe Guangfu"}]}`},
+		{"xml", decodeAstrosXML, `<astros><people>` +
+			`<astro><craft> ISS </craft><name> Mark Vande Hei </name></astro>` +
+			`<astro><craft>Shenzhou 13	</craft><name>
+Ye Guangfu</name></astro>` +
+			`</people></astros>`},
+	} {
+		a, err := tc.decode(strings.NewReader(tc.input))
+		if err != nil {
+			t.Errorf("%s: got error %v", tc.desc, err)
+			continue
+		}
+		if !reflect.DeepEqual(a.People, want) {
+			t.Errorf("%s: got %q want %q", tc.desc, a.People, want)
+		}
+	}
+}
+
+func TestWriteYAML(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		a    astros
+		want string
+	}{
+		{"recomputed number", astros{People: []astro{{"ISS", "Raja Chari"}, {"ISS", "Tom Marshburn"}}, Number: 7, Message: "success"}, "" +
+			"people:\n" +
+			"  - craft: ISS\n" +
+			"    name: Raja Chari\n" +
+			"  - craft: ISS\n" +
+			"    name: Tom Marshburn\n" +
+			"number: 2\n" +
+			"message: success\n"},
+		{"no message", astros{People: []astro{{"ISS", "Raja Chari"}}}, "" +
+			"people:\n" +
+			"  - craft: ISS\n" +
+			"    name: Raja Chari\n" +
+			"number: 1\n"},
+		{"no one", astros{}, "" +
+			"people: []\n" +
+			"number: 0\n"},
+	} {
+		var b strings.Builder
+		if err := writeYAML(&b, tc.a); err != nil {
+			t.Errorf("%s: got error %v", tc.desc, err)
+		}
+		if got := b.String(); got != tc.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tc.desc, got, tc.want)
+		}
+	}
+}
+
+func TestPrintGrouped(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		a    astros
+		want string
+	}{
+		{"no one", astros{}, "(no one in space)\n"},
+		{"size, then craft, then name", astros{People: []astro{
+			{"Tiangong", "Ye Guangfu"},
+			{"ISS", "Tom Marshburn"},
+			{"Soyuz", "Pyotr Dubrov"},
+			{"ISS", "Raja Chari"},
+			{"Tiangong", "Wang Yaping"},
+			{"ISS", "Kayla Barron"},
+			{"Dragon", "Matthias Maurer"},
+			{"Dragon", "Mark Vande Hei"},
+		}}, "" +
+			"ISS (3)\n" +
+			"    Kayla Barron\n" +
+			"    Raja Chari\n" +
+			"    Tom Marshburn\n" +
+			"Dragon (2)\n" +
+			"    Mark Vande Hei\n" +
+			"    Matthias Maurer\n" +
+			"Tiangong (2)\n" +
+			"    Wang Yaping\n" +
+			"    Ye Guangfu\n" +
+			"Soyuz (1)\n" +
+			"    Pyotr Dubrov\n" +
+			"Total: 8 people across 4 craft\n"},
+	} {
+		var b strings.Builder
+		tc.a.printGrouped(&b)
+		if got := b.String(); got != tc.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tc.desc, got, tc.want)
+		}
+	}
+}
+
+func TestWriteAstrosCSV(t *testing.T) {
+	a := astros{People: []astro{
+		{"Tiangong", "Ye Guangfu"},
+		{"ISS", "Raja Chari"},
+		{"ISS", "Doe, Jane"},
+		{"Dragon", "Mark Vande Hei"},
+	}}
+	want := "" +
+		"Craft,Name\n" +
+		"Dragon,Mark Vande Hei\n" +
+		"ISS,\"Doe, Jane\"\n" +
+		"ISS,Raja Chari\n" +
+		"Tiangong,Ye Guangfu\n"
+	var b strings.Builder
+	if err := writeAstrosCSV(&b, a); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+	if a.People[0].Name != "Ye Guangfu" {
+		t.Errorf("writeAstrosCSV reordered its input: %+v", a.People)
+	}
+}
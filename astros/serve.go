@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// cacheTTL is how long the server reuses loaded astronauts before reloading them.
+const cacheTTL = time.Minute
+
+// shutdownTimeout is how long in-flight requests may take to finish on shutdown.
+const shutdownTimeout = 10 * time.Second
+
+// crewCache holds the most recently loaded astronauts.
+type crewCache struct {
+	load func() (astros, error)
+
+	mu      sync.Mutex
+	crew    astros
+	fetched time.Time
+	loading bool
+}
+
+// get returns the cached astronauts, reloading them if they are older than
+// cacheTTL. Only one caller reloads at a time, without holding the lock; the
+// others get the previous crew meanwhile. If a reload fails, the previous crew
+// is kept for another cacheTTL. An error is returned only if nothing has been
+// loaded yet.
+func (c *crewCache) get() (astros, error) {
+	c.mu.Lock()
+	crew, fetched := c.crew, c.fetched
+	reload := time.Since(fetched) >= cacheTTL && !c.loading
+	if reload {
+		c.loading = true
+	}
+	c.mu.Unlock()
+	if !reload {
+		return crew, nil
+	}
+
+	a, err := c.load()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.loading = false
+	if err != nil {
+		if fetched.IsZero() {
+			return astros{}, err
+		}
+		slog.Warn("unable to reload astronauts, serving the previous crew", "fetched", fetched, "err", err)
+		c.fetched = time.Now()
+		return crew, nil
+	}
+	c.crew, c.fetched = a, time.Now()
+	return a, nil
+}
+
+// handleAstros serves the astronauts as JSON, optionally filtered by the craft
+// query parameter.
+func (c *crewCache) handleAstros(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	a, err := c.get()
+	if err != nil {
+		slog.Error("unable to load astronauts", "err", err)
+		http.Error(w, "unable to load astronauts", http.StatusInternalServerError)
+		return
+	}
+	if craft := r.URL.Query().Get("craft"); craft != "" {
+		a = astros{People: a.onCraft(craft)}
+	}
+	if a.People == nil {
+		a.People = []astro{}
+	}
+	a.Message = "success"
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(a); err != nil {
+		slog.Error("unable to write response", "err", err)
+	}
+}
+
+// serve serves the astronauts on addr until the process is interrupted or
+// terminated, and then waits for in-flight requests to finish.
+// Astronauts are loaded once at startup and reloaded at most once per cacheTTL.
+func serve(addr string, load func() (astros, error)) error {
+	c := &crewCache{load: load}
+	if _, err := c.get(); err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/astros", c.handleAstros)
+	srv := &http.Server{Addr: addr, Handler: mux}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.ListenAndServe()
+	}()
+	slog.Info("serving", "addr", addr)
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	slog.Info("shutting down")
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		return err
+	}
+	slog.Info("stopped")
+	return nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHandleAstros(t *testing.T) {
+	crew := astros{People: []astro{{"ISS", "Raja Chari"}, {"Shenzhou 13", "Ye Guangfu"}}, Number: 2}
+	loaded := func() (astros, error) { return crew, nil }
+	failed := func() (astros, error) { return astros{}, errors.New("feed is down") }
+	for _, tc := range []struct {
+		desc       string
+		method     string
+		target     string
+		cache      *crewCache
+		wantStatus int
+		wantBody   string
+	}{
+		{"all", http.MethodGet, "/astros", &crewCache{load: loaded}, http.StatusOK,
+			`{"people":[{"craft":"ISS","name":"Raja Chari"},{"craft":"Shenzhou 13","name":"Ye Guangfu"}],"number":2,"message":"success"}` + "\n"},
+		{"craft filter", http.MethodGet, "/astros?craft=iss", &crewCache{load: loaded}, http.StatusOK,
+			`{"people":[{"craft":"ISS","name":"Raja Chari"}],"number":1,"message":"success"}` + "\n"},
+		{"no one on craft", http.MethodGet, "/astros?craft=mir", &crewCache{load: loaded}, http.StatusOK,
+			`{"people":[],"number":0,"message":"success"}` + "\n"},
+		{"failed reload serves previous crew", http.MethodGet, "/astros?craft=shenzhou%2013",
+			&crewCache{load: failed, crew: crew, fetched: time.Now().Add(-2 * cacheTTL)}, http.StatusOK,
+			`{"people":[{"craft":"Shenzhou 13","name":"Ye Guangfu"}],"number":1,"message":"success"}` + "\n"},
+		{"nothing loaded", http.MethodGet, "/astros", &crewCache{load: failed}, http.StatusInternalServerError,
+			"unable to load astronauts\n"},
+		{"post", http.MethodPost, "/astros", &crewCache{load: loaded}, http.StatusMethodNotAllowed,
+			"method not allowed\n"},
+	} {
+		w := httptest.NewRecorder()
+		tc.cache.handleAstros(w, httptest.NewRequest(tc.method, tc.target, nil))
+
+		if w.Code != tc.wantStatus {
+			t.Errorf("%s: got status %d want %d", tc.desc, w.Code, tc.wantStatus)
+		}
+		if got := w.Body.String(); got != tc.wantBody {
+			t.Errorf("%s: got body %q want %q", tc.desc, got, tc.wantBody)
+		}
+		if tc.wantStatus == http.StatusOK {
+			if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("%s: got Content-Type %q want application/json", tc.desc, ct)
+			}
+		}
+	}
+}
+
+func TestCrewCacheReloadsInBackground(t *testing.T) {
+	old := astros{People: []astro{{"ISS", "Raja Chari"}}}
+	release := make(chan struct{})
+	c := &crewCache{
+		load: func() (astros, error) {
+			<-release
+			return astros{People: []astro{{"ISS", "Tom Marshburn"}}}, nil
+		},
+		crew:    old,
+		fetched: time.Now().Add(-2 * cacheTTL),
+	}
+	done := make(chan astros)
+	go func() {
+		a, _ := c.get()
+		done <- a
+	}()
+	// Wait until the reload has started, then check that other callers are
+	// not blocked by it.
+	for {
+		c.mu.Lock()
+		loading := c.loading
+		c.mu.Unlock()
+		if loading {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if a, err := c.get(); err != nil || a.People[0].Name != "Raja Chari" {
+		t.Errorf("during reload: got %+v, %v; want the previous crew", a, err)
+	}
+	close(release)
+	if a := <-done; a.People[0].Name != "Tom Marshburn" {
+		t.Errorf("after reload: got %+v want the new crew", a)
+	}
+}
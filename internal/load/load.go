@@ -0,0 +1,47 @@
+// Package load opens the input files of the struct programs.
+package load
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Stdin is the path that selects the standard input.
+const Stdin = "-"
+
+// bom is the UTF-8 byte order mark, which some editors put at the start of a file.
+var bom = []byte{0xEF, 0xBB, 0xBF}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// OpenReader opens the file at path for reading, or the standard input if path
+// is "-". A leading UTF-8 byte order mark is skipped. Closing the standard
+// input is a no-op.
+func OpenReader(path string) (io.ReadCloser, error) {
+	var rc io.ReadCloser
+	if path == Stdin {
+		rc = io.NopCloser(os.Stdin)
+	} else {
+		f, err := os.Open(path)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("missing file: %w", err)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to open a file: %w", err)
+		}
+		rc = f
+	}
+
+	r := bufio.NewReader(rc)
+	if b, err := r.Peek(len(bom)); err == nil && bytes.Equal(b, bom) {
+		r.Discard(len(bom))
+	}
+	return readCloser{r, rc}, nil
+}
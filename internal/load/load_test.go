@@ -0,0 +1,49 @@
+package load
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenReader(t *testing.T) {
+	for _, tc := range []struct {
+		desc    string
+		content string
+		want    string
+	}{
+		{"no bom", "people", "people"},
+		{"bom at start", "\xef\xbb\xbfpeople", "people"},
+		{"bom later", "peo\xef\xbb\xbfple", "peo\xef\xbb\xbfple"},
+		{"only bom", "\xef\xbb\xbf", ""},
+		{"short file", "ab", "ab"},
+		{"empty file", "", ""},
+	} {
+		path := filepath.Join(t.TempDir(), "input")
+		if err := os.WriteFile(path, []byte(tc.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		r, err := OpenReader(path)
+		if err != nil {
+			t.Errorf("%s: got error %v", tc.desc, err)
+			continue
+		}
+		got, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Errorf("%s: got error %v", tc.desc, err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("%s: got %q want %q", tc.desc, got, tc.want)
+		}
+	}
+}
+
+func TestOpenReaderMissingFile(t *testing.T) {
+	_, err := OpenReader(filepath.Join(t.TempDir(), "missing"))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("got error %v want %v", err, os.ErrNotExist)
+	}
+}
@@ -0,0 +1,50 @@
+// Package record formats tabular records for the struct programs.
+package record
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// Record is a row of a table.
+type Record interface {
+	// Fields returns the column values.
+	Fields() []string
+}
+
+// WriteTable writes recs to w as a table with aligned columns, preceded by a
+// header row and a separator. The headers name the columns in the order the
+// records' Fields returns them. They are passed separately from the records so
+// that an empty table still has them.
+func WriteTable(w io.Writer, headers []string, recs []Record) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(headers, "\t"))
+	sep := make([]string, len(headers))
+	for i, h := range headers {
+		sep[i] = strings.Repeat("-", len(h))
+	}
+	fmt.Fprintln(tw, strings.Join(sep, "\t"))
+	for _, r := range recs {
+		fmt.Fprintln(tw, strings.Join(r.Fields(), "\t"))
+	}
+	return tw.Flush()
+}
+
+// WriteCSV writes recs to w as CSV, preceded by a header row. Fields that
+// contain commas, quotes or newlines are quoted.
+func WriteCSV(w io.Writer, headers []string, recs []Record) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(headers); err != nil {
+		return err
+	}
+	for _, r := range recs {
+		if err := cw.Write(r.Fields()); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,59 @@
+package record
+
+import (
+	"strings"
+	"testing"
+)
+
+type pair struct{ key, value string }
+
+var pairHeaders = []string{"Key", "Value"}
+
+func (p pair) Fields() []string { return []string{p.key, p.value} }
+
+func TestWriteTable(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		recs []Record
+		want string
+	}{
+		{"empty", nil, "" +
+			"Key  Value\n" +
+			"---  -----\n"},
+		{"aligned", []Record{pair{"ISS", "Raja Chari"}, pair{"Shenzhou 13", "Ye Guangfu"}}, "" +
+			"Key          Value\n" +
+			"---          -----\n" +
+			"ISS          Raja Chari\n" +
+			"Shenzhou 13  Ye Guangfu\n"},
+	} {
+		var b strings.Builder
+		if err := WriteTable(&b, pairHeaders, tc.recs); err != nil {
+			t.Errorf("%s: got error %v", tc.desc, err)
+		}
+		if got := b.String(); got != tc.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tc.desc, got, tc.want)
+		}
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		recs []Record
+		want string
+	}{
+		{"empty", nil, "Key,Value\n"},
+		{"quoted", []Record{pair{"ISS", "Doe, Jane"}, pair{"Soyuz", `Say "hi"`}}, "" +
+			"Key,Value\n" +
+			"ISS,\"Doe, Jane\"\n" +
+			"Soyuz,\"Say \"\"hi\"\"\"\n"},
+	} {
+		var b strings.Builder
+		if err := WriteCSV(&b, pairHeaders, tc.recs); err != nil {
+			t.Errorf("%s: got error %v", tc.desc, err)
+		}
+		if got := b.String(); got != tc.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tc.desc, got, tc.want)
+		}
+	}
+}